@@ -0,0 +1,54 @@
+package openid
+
+import "testing"
+
+// TestClaimSatisfies covers the equality, slice-membership and
+// slice-intersection cases claimSatisfies is responsible for, including a
+// regression test for the panic fixed previously: comparing two
+// []interface{} values with == panics at runtime because slices aren't
+// comparable, which claimSatisfies must avoid when both the claim and the
+// required value are slices.
+func TestClaimSatisfies(t *testing.T) {
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+		ok   bool
+	}{
+		{name: "equal scalars match", got: "admin", want: "admin", ok: true},
+		{name: "unequal scalars don't match", got: "admin", want: "user", ok: false},
+		{name: "scalar claim satisfies one of the required values", got: "admin", want: []interface{}{"admin", "user"}, ok: true},
+		{name: "scalar claim satisfies none of the required values", got: "guest", want: []interface{}{"admin", "user"}, ok: false},
+		{name: "slice claim intersects the required values", got: []interface{}{"user", "admin"}, want: []interface{}{"admin", "root"}, ok: true},
+		{name: "slice claim does not intersect the required values", got: []interface{}{"user", "guest"}, want: []interface{}{"admin", "root"}, ok: false},
+		{name: "empty slice claim never satisfies a required slice", got: []interface{}{}, want: []interface{}{"admin"}, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := claimSatisfies(tt.got, tt.want); got != tt.ok {
+				t.Fatalf("claimSatisfies(%#v, %#v) = %v, want %v", tt.got, tt.want, got, tt.ok)
+			}
+		})
+	}
+}
+
+// TestClaimSatisfiesDoesNotPanicOnTwoSliceClaims is a direct regression test
+// for the bug: got == want panicked at runtime whenever both operands were
+// []interface{} - exactly the case a declared RequiredClaims set-membership
+// entry (e.g. a required 'groups' list) hits when the token's own claim is
+// also a JSON array, which is the primary use case the feature was built for.
+func TestClaimSatisfiesDoesNotPanicOnTwoSliceClaims(t *testing.T) {
+	got := []interface{}{"user", "guest"}
+	want := []interface{}{"admin", "root"}
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("claimSatisfies panicked comparing two slice claims: %v", r)
+		}
+	}()
+
+	if claimSatisfies(got, want) {
+		t.Fatalf("expected non-intersecting slice claims not to satisfy each other")
+	}
+}
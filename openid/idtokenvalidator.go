@@ -1,11 +1,13 @@
 package openid
 
 import (
-	"crypto/rsa"
+	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 const issuerClaimName = "iss"
@@ -17,34 +19,76 @@ type jwtTokenValidator interface {
 	validate(r *http.Request, t string) (jt *jwt.Token, err error)
 }
 
-type jwtParserFunc func(string, jwt.Keyfunc) (*jwt.Token, error)
-type pemToRSAPublicKeyParserFunc func(key []byte) (*rsa.PublicKey, error)
+type jwtParserFunc func(string, jwt.Keyfunc, ...jwt.ParserOption) (*jwt.Token, error)
+
+// jwkKeyParserFunc turns the raw JWK bytes handed back by a signingKeyGetter
+// into the concrete public key (*rsa.PublicKey, *ecdsa.PublicKey or
+// ed25519.PublicKey) that jwt.Parse needs to verify a signature.
+type jwkKeyParserFunc func(key []byte) (interface{}, error)
+
+// ClaimValidator lets applications enforce checks beyond the built-in
+// iss/aud/sub trio and the declarative RequiredClaims map, e.g. step-up auth
+// or claim shapes that can't be expressed as a simple equality/membership
+// test.
+type ClaimValidator interface {
+	Validate(claims jwt.MapClaims) *ValidationError
+}
 
 type idTokenValidator struct {
-	provGetter GetProvidersFunc
-	jwtParser  jwtParserFunc
-	keyGetter  signingKeyGetter
-	rsaParser  pemToRSAPublicKeyParserFunc
+	provGetter       GetProvidersFunc
+	jwtParser        jwtParserFunc
+	keyGetter        signingKeyGetter
+	keyParser        jwkKeyParserFunc
+	claimValidators  []ClaimValidator
+	allowedClockSkew time.Duration
+	clock            func() time.Time
+	maxTokenAge      time.Duration
+	refreshLimiter   *jwksRefreshLimiter
 }
 
-func newIDTokenValidator(pg GetProvidersFunc, jp jwtParserFunc, kg signingKeyGetter, kp pemToRSAPublicKeyParserFunc) *idTokenValidator {
-	return &idTokenValidator{pg, jp, kg, kp}
+func newIDTokenValidator(pg GetProvidersFunc, jp jwtParserFunc, kg signingKeyGetter, kp jwkKeyParserFunc, cv ...ClaimValidator) *idTokenValidator {
+	return &idTokenValidator{
+		provGetter:      pg,
+		jwtParser:       jp,
+		keyGetter:       kg,
+		keyParser:       kp,
+		claimValidators: cv,
+		clock:           time.Now,
+		refreshLimiter:  newJwksRefreshLimiter(0, 0),
+	}
+}
+
+func (tv *idTokenValidator) now() time.Time {
+	if tv.clock != nil {
+		return tv.clock()
+	}
+	return time.Now()
 }
 
 func (tv *idTokenValidator) validate(r *http.Request, t string) (*jwt.Token, error) {
+	// Time-based claims (exp/nbf/iat) are validated explicitly below, with
+	// our own clock and skew allowance, so that callers get distinct
+	// ValidationError codes instead of jwt-go's single "token is expired"
+	// style error.
+	//
+	// The algorithm allow-list can't be passed as a jwt.WithValidMethods
+	// ParserOption: that argument is evaluated before the keyfunc below ever
+	// runs, so it could never see the matching provider's
+	// AllowedAlgorithms. Instead the keyfunc itself rejects any token whose
+	// 'alg' isn't allowed for the resolved provider, via validateAlgorithm.
+	opts := jwt.WithoutClaimsValidation()
+
 	jt, err := tv.jwtParser(t, func(tok *jwt.Token) (interface{}, error) {
 		return tv.getSigningKey(r, tok)
-	})
+	}, opts)
 	if err != nil {
 
-		if verr, ok := err.(*jwt.ValidationError); ok {
-			// If the signing key did not match it may be because the in memory key is outdated.
-			// Renew the cached signing key.
-			if (verr.Errors & jwt.ValidationErrorSignatureInvalid) != 0 {
-				jt, err = tv.jwtParser(t, func(tok *jwt.Token) (interface{}, error) {
-					return tv.renewAndGetSigningKey(r, tok)
-				})
-			}
+		// If the signing key did not match it may be because the in memory key is outdated.
+		// Renew the cached signing key.
+		if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			jt, err = tv.jwtParser(t, func(tok *jwt.Token) (interface{}, error) {
+				return tv.renewAndGetSigningKey(r, tok)
+			}, opts)
 		}
 	}
 
@@ -52,23 +96,106 @@ func (tv *idTokenValidator) validate(r *http.Request, t string) (*jwt.Token, err
 		return nil, jwtErrorToOpenIDError(err)
 	}
 
+	if err := tv.validateTimeClaims(jt); err != nil {
+		return nil, err
+	}
+
+	if err := tv.validateProofOfPossession(r, t, jt); err != nil {
+		return nil, err
+	}
+
 	return jt, nil
 }
 
-func (tv *idTokenValidator) renewAndGetSigningKey(r *http.Request, jt *jwt.Token) (interface{}, error) {
-	// Issuer is already validated when 'getSigningKey was called.
-	iss := jt.Claims.(jwt.MapClaims)[issuerClaimName].(string)
+// validateProofOfPossession re-resolves the provider a (now signature- and
+// time-verified) token belongs to and, if that provider requires
+// sender-constrained tokens, enforces the mTLS/DPoP 'cnf' binding against
+// the current request.
+func (tv *idTokenValidator) validateProofOfPossession(r *http.Request, t string, jt *jwt.Token) error {
+	provs, err := tv.provGetter()
+	if err != nil {
+		return err
+	}
 
-	err := tv.keyGetter.flushCachedSigningKeys(iss)
+	p, err := validateIssuer(jt, provs)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	return validateProofOfPossession(r, t, jt, p)
+}
+
+// allOrDefaultAlgorithms restricts verification to the algorithms allowed by
+// the matching provider, falling back to the RSA/ECDSA/EdDSA algorithms this
+// package knows how to verify when the provider has not opted into a
+// narrower list. The default list never includes "none", preventing
+// alg-downgrade attacks; a provider's own list is returned as configured.
+func allOrDefaultAlgorithms(algs []string) []string {
+	if len(algs) > 0 {
+		return algs
+	}
+
+	return []string{
+		jwt.SigningMethodRS256.Alg(), jwt.SigningMethodRS384.Alg(), jwt.SigningMethodRS512.Alg(),
+		jwt.SigningMethodES256.Alg(), jwt.SigningMethodES384.Alg(), jwt.SigningMethodES512.Alg(),
+		jwt.SigningMethodEdDSA.Alg(),
+	}
+}
+
+// validateAlgorithm rejects a token whose header 'alg' is not in the
+// resolved provider's allowed algorithm list (or the package default when
+// the provider hasn't configured one). This can't be expressed as a
+// jwt.WithValidMethods ParserOption because the provider isn't known until
+// the keyfunc this runs inside of has resolved the issuer.
+func validateAlgorithm(jt *jwt.Token, p *Provider) error {
+	alg := jt.Method.Alg()
+
+	for _, allowed := range allOrDefaultAlgorithms(p.AllowedAlgorithms) {
+		if alg == allowed {
+			return nil
+		}
 	}
 
+	return &ValidationError{
+		Code:       ValidationErrorUnexpectedSigningMethod,
+		Message:    fmt.Sprintf("The provider %v does not allow the token's signing algorithm: %v.", p.Issuer, alg),
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
+
+func (tv *idTokenValidator) renewAndGetSigningKey(r *http.Request, jt *jwt.Token) (interface{}, error) {
+	// Issuer and algorithm are already validated when 'getSigningKey was called.
+	iss := jt.Claims.(jwt.MapClaims)[issuerClaimName].(string)
+
 	kid := getTokenKid(jt)
 
-	var key []byte
-	if key, err = tv.keyGetter.getSigningKey(r, iss, kid); err == nil {
-		return tv.rsaParser(key)
+	// A flood of tokens carrying unknown kids, or with a bad signature over
+	// an otherwise-known kid, would otherwise force a JWKS re-fetch per
+	// request. The rate limiter is consulted once per coalesced refresh,
+	// inside the singleflight-protected function, rather than once per
+	// caller ahead of it - otherwise, with the default burst, only the
+	// first few of many callers discovering a legitimate key rotation at
+	// the same time would even attempt the refresh, and the rest would be
+	// spuriously throttled even though the leader's fetch would have
+	// satisfied them.
+	refreshErr := tv.refreshLimiter.refresh(iss, func() error {
+		if !tv.refreshLimiter.allow(iss) {
+			return throttledJwksRefreshError(iss)
+		}
+		return tv.keyGetter.flushCachedSigningKeys(iss)
+	})
+
+	// Re-check the cache regardless of whether the refresh ran, was
+	// coalesced into someone else's, or was throttled: only a caller whose
+	// kid is genuinely still missing afterwards is rejected, and only then
+	// with the throttled error if that's why the refresh didn't happen.
+	key, err := tv.keyGetter.getSigningKey(r, iss, kid)
+	if err == nil {
+		return tv.keyParser(key)
+	}
+
+	if refreshErr != nil {
+		return nil, refreshErr
 	}
 
 	return nil, err
@@ -89,6 +216,10 @@ func (tv *idTokenValidator) getSigningKey(r *http.Request, jt *jwt.Token) (inter
 		return nil, err
 	}
 
+	if err = validateAlgorithm(jt, p); err != nil {
+		return nil, err
+	}
+
 	_, err = validateAudiences(jt, p)
 	if err != nil {
 		return nil, err
@@ -98,16 +229,159 @@ func (tv *idTokenValidator) getSigningKey(r *http.Request, jt *jwt.Token) (inter
 		return nil, err
 	}
 
+	if err = validateRequiredClaims(jt, p); err != nil {
+		return nil, err
+	}
+
+	if err = tv.validateClaimValidators(jt); err != nil {
+		return nil, err
+	}
+
 	kid := getTokenKid(jt)
 
 	var key []byte
 	if key, err = tv.keyGetter.getSigningKey(r, p.Issuer, kid); err == nil {
-		return tv.rsaParser(key)
+		return tv.keyParser(key)
 	}
 
 	return nil, err
 }
 
+// validateClaimValidators runs every ClaimValidator registered on the
+// provider's Configuration against the token claims, stopping at the first
+// failure.
+func (tv *idTokenValidator) validateClaimValidators(jt *jwt.Token) error {
+	claims := jt.Claims.(jwt.MapClaims)
+
+	for _, cv := range tv.claimValidators {
+		if verr := cv.Validate(claims); verr != nil {
+			return verr
+		}
+	}
+
+	return nil
+}
+
+// validateRequiredClaims asserts that every claim named in p.RequiredClaims
+// is present on the token and either equals the configured value or, when
+// the configured value is a slice, that the token claim contains it (or is
+// itself a slice that intersects it). This covers set-membership checks like
+// a required "groups" entry without requiring a custom ClaimValidator.
+func validateRequiredClaims(jt *jwt.Token, p *Provider) error {
+	if len(p.RequiredClaims) == 0 {
+		return nil
+	}
+
+	claims := jt.Claims.(jwt.MapClaims)
+
+	for name, want := range p.RequiredClaims {
+		got, ok := claims[name]
+		if !ok {
+			return &ValidationError{
+				Code:       ValidationErrorRequiredClaimMissing,
+				Message:    fmt.Sprintf("The token is missing the required claim '%v'.", name),
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+
+		if !claimSatisfies(got, want) {
+			return &ValidationError{
+				Code:       ValidationErrorRequiredClaimMismatch,
+				Message:    fmt.Sprintf("The token claim '%v' (%+v) does not satisfy the required value %+v.", name, got, want),
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+	}
+
+	return nil
+}
+
+// claimSatisfies reports whether the token's claim value matches what was
+// required: equal values match outright, a required slice is satisfied if
+// the claim equals or (when the claim is itself a slice) contains any of the
+// required entries.
+func claimSatisfies(got, want interface{}) bool {
+	wantValues, wantIsSlice := want.([]interface{})
+	if !wantIsSlice {
+		// want isn't a []interface{} here. If got is itself an uncomparable
+		// type (e.g. a slice or a map), it simply doesn't match; checking
+		// that first keeps == from panicking on two values of that type.
+		if gt := reflect.TypeOf(got); gt != nil && !gt.Comparable() {
+			return false
+		}
+		return got == want
+	}
+
+	gotValues, gotIsSlice := got.([]interface{})
+
+	for _, w := range wantValues {
+		if !gotIsSlice {
+			if got == w {
+				return true
+			}
+			continue
+		}
+
+		for _, g := range gotValues {
+			if g == w {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// validateTimeClaims enforces exp/nbf/iat using tv.clock and
+// tv.allowedClockSkew as leeway in both directions, and, when
+// tv.maxTokenAge is set, rejects tokens whose iat is older than that bound
+// regardless of how far out exp is.
+func (tv *idTokenValidator) validateTimeClaims(jt *jwt.Token) error {
+	claims := jt.Claims.(jwt.MapClaims)
+	now := tv.now()
+
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		if now.After(exp.Add(tv.allowedClockSkew)) {
+			return &ValidationError{
+				Code:       ValidationErrorTokenExpired,
+				Message:    fmt.Sprintf("The token expired at %v.", exp),
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+	}
+
+	if nbf, err := claims.GetNotBefore(); err == nil && nbf != nil {
+		if now.Before(nbf.Add(-tv.allowedClockSkew)) {
+			return &ValidationError{
+				Code:       ValidationErrorTokenNotYetValid,
+				Message:    fmt.Sprintf("The token is not valid until %v.", nbf),
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err == nil && iat != nil {
+		if now.Before(iat.Add(-tv.allowedClockSkew)) {
+			return &ValidationError{
+				Code:       ValidationErrorIatInFuture,
+				Message:    fmt.Sprintf("The token was issued in the future, at %v.", iat),
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+
+		if tv.maxTokenAge > 0 && now.After(iat.Add(tv.maxTokenAge+tv.allowedClockSkew)) {
+			return &ValidationError{
+				Code:       ValidationErrorTokenTooOld,
+				Message:    fmt.Sprintf("The token was issued at %v, which exceeds the maximum allowed age of %v.", iat, tv.maxTokenAge),
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+	}
+
+	return nil
+}
+
 func getTokenKid(jt *jwt.Token) string {
 	kid, _ := jt.Header[keyIDJwtHeaderName].(string)
 	return kid
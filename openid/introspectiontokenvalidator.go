@@ -0,0 +1,270 @@
+package openid
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+// ValidationMode selects how a Provider's bearer tokens are validated.
+type ValidationMode int
+
+const (
+	// ValidationModeJWT verifies the token as a self-contained, signed JWT
+	// against the provider's JWKS. This is the default.
+	ValidationModeJWT ValidationMode = iota
+	// ValidationModeIntrospection treats the token as an opaque reference
+	// and validates it via RFC 7662 token introspection, as used by
+	// providers such as Keycloak or Auth0 for opaque access tokens.
+	ValidationModeIntrospection
+)
+
+// ClientAuthMethod selects how the introspection client authenticates
+// itself to the introspection endpoint.
+type ClientAuthMethod int
+
+const (
+	// ClientAuthSecretBasic sends the client id/secret as HTTP Basic auth.
+	ClientAuthSecretBasic ClientAuthMethod = iota
+	// ClientAuthSecretPost sends the client id/secret as form fields.
+	ClientAuthSecretPost
+	// ClientAuthNone sends no client authentication at all.
+	ClientAuthNone
+)
+
+const tokenTypeHintClaimName = "token_type_hint"
+const activeClaimName = "active"
+const scopeClaimName = "scope"
+const expiresClaimName = "exp"
+
+// introspectionCacheEntry holds a positive introspection result along with
+// the instant it stops being trustworthy.
+type introspectionCacheEntry struct {
+	jt        *jwt.Token
+	expiresAt time.Time
+}
+
+// introspectionTokenValidator implements jwtTokenValidator by calling a
+// provider's RFC 7662 introspection_endpoint instead of verifying a JWT
+// signature locally. It is used for providers configured with
+// ValidationModeIntrospection, typically to support opaque access tokens.
+type introspectionTokenValidator struct {
+	provGetter      GetProvidersFunc
+	httpClient      *http.Client
+	maxTTL          time.Duration
+	claimValidators []ClaimValidator
+
+	mu    sync.Mutex
+	cache map[string]introspectionCacheEntry
+	group singleflight.Group
+}
+
+func newIntrospectionTokenValidator(pg GetProvidersFunc, hc *http.Client, maxTTL time.Duration, cv ...ClaimValidator) *introspectionTokenValidator {
+	return &introspectionTokenValidator{
+		provGetter:      pg,
+		httpClient:      hc,
+		maxTTL:          maxTTL,
+		claimValidators: cv,
+		cache:           make(map[string]introspectionCacheEntry),
+	}
+}
+
+// validateClaimValidators runs every ClaimValidator registered on the
+// provider's Configuration against the token claims, stopping at the first
+// failure. Mirrors idTokenValidator.validateClaimValidators for the
+// introspection path.
+func (tv *introspectionTokenValidator) validateClaimValidators(jt *jwt.Token) error {
+	claims := jt.Claims.(jwt.MapClaims)
+
+	for _, cv := range tv.claimValidators {
+		if verr := cv.Validate(claims); verr != nil {
+			return verr
+		}
+	}
+
+	return nil
+}
+
+func (tv *introspectionTokenValidator) validate(r *http.Request, t string) (*jwt.Token, error) {
+	if jt, ok := tv.cached(t); ok {
+		return jt, nil
+	}
+
+	v, err, _ := tv.group.Do(t, func() (interface{}, error) {
+		if jt, ok := tv.cached(t); ok {
+			return jt, nil
+		}
+		return tv.introspect(r, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*jwt.Token), nil
+}
+
+func (tv *introspectionTokenValidator) cached(t string) (*jwt.Token, bool) {
+	tv.mu.Lock()
+	defer tv.mu.Unlock()
+
+	entry, ok := tv.cache[t]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(tv.cache, t)
+		return nil, false
+	}
+
+	return entry.jt, true
+}
+
+func (tv *introspectionTokenValidator) introspect(r *http.Request, t string) (*jwt.Token, error) {
+	provs, err := tv.provGetter()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := providers(provs).validate(); err != nil {
+		return nil, err
+	}
+
+	var claims jwt.MapClaims
+	var p *Provider
+	var lastErr error
+
+	// A candidate provider's introspection endpoint being unreachable or
+	// erroring shouldn't prevent trying the rest; only give up once every
+	// introspection provider has either rejected the token or failed.
+	for i := range provs {
+		candidate := provs[i]
+		if candidate.ValidationMode != ValidationModeIntrospection {
+			continue
+		}
+
+		candidateClaims, cerr := tv.callIntrospectionEndpoint(r, &candidate, t)
+		if cerr != nil {
+			lastErr = cerr
+			continue
+		}
+
+		if active, _ := candidateClaims[activeClaimName].(bool); active {
+			claims = candidateClaims
+			p = &candidate
+			break
+		}
+	}
+
+	if p == nil {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, &ValidationError{
+			Code:       ValidationErrorTokenInactive,
+			Message:    "The introspection endpoint reported the token as inactive or no introspection provider recognized it.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	jt := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	jt.Valid = true
+
+	// An introspection endpoint reporting active=true only proves the token
+	// is a real, live token issued by p - it says nothing about whether it
+	// was issued to this audience or satisfies the same claim/proof-of-
+	// possession requirements the JWT path enforces. Gate on all of them
+	// the same way getSigningKey/validateProofOfPossession do before
+	// trusting the token.
+	if _, err := validateAudiences(jt, p); err != nil {
+		return nil, err
+	}
+
+	if err := validateRequiredClaims(jt, p); err != nil {
+		return nil, err
+	}
+
+	if err := tv.validateClaimValidators(jt); err != nil {
+		return nil, err
+	}
+
+	if err := validateProofOfPossession(r, t, jt, p); err != nil {
+		return nil, err
+	}
+
+	ttl := tv.maxTTL
+	if exp, ok := claims[expiresClaimName].(float64); ok {
+		if remaining := time.Until(time.Unix(int64(exp), 0)); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	if ttl > 0 {
+		tv.mu.Lock()
+		tv.cache[t] = introspectionCacheEntry{jt: jt, expiresAt: time.Now().Add(ttl)}
+		tv.mu.Unlock()
+	}
+
+	return jt, nil
+}
+
+// callIntrospectionEndpoint POSTs the token to p's introspection_endpoint
+// and maps the RFC 7662 response fields (active/iss/aud/sub/exp/scope) onto
+// the jwt.MapClaims shape the rest of the package already understands.
+func (tv *introspectionTokenValidator) callIntrospectionEndpoint(r *http.Request, p *Provider, t string) (jwt.MapClaims, error) {
+	form := url.Values{}
+	form.Set("token", t)
+	form.Set(tokenTypeHintClaimName, "access_token")
+	if p.ClientAuthMethod == ClientAuthSecretPost {
+		form.Set("client_id", p.ClientID)
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, p.IntrospectionEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if p.ClientAuthMethod == ClientAuthSecretBasic {
+		req.SetBasicAuth(p.ClientID, p.ClientSecret)
+	}
+
+	resp, err := tv.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ValidationError{
+			Code:       ValidationErrorIntrospectionFailed,
+			Message:    fmt.Sprintf("The introspection endpoint %v returned status %v.", p.IntrospectionEndpoint, resp.StatusCode),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	var raw map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, &ValidationError{
+			Code:       ValidationErrorIntrospectionFailed,
+			Message:    fmt.Sprintf("Failed to decode the introspection response: %v.", err),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	claims := jwt.MapClaims{}
+	for _, name := range []string{activeClaimName, issuerClaimName, audiencesClaimName, subjectClaimName, expiresClaimName, scopeClaimName} {
+		if v, ok := raw[name]; ok {
+			claims[name] = v
+		}
+	}
+
+	return claims, nil
+}
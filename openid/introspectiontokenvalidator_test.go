@@ -0,0 +1,125 @@
+package openid
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func jsonResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+	}
+}
+
+func newTestIntrospectionRequest() *http.Request {
+	return httptest.NewRequest(http.MethodGet, "https://resource.example.com/data", nil)
+}
+
+// TestIntrospectTriesRemainingProvidersAfterOneFails is a regression test for
+// the bug where a single introspection endpoint failing (network error,
+// non-200 status) aborted the whole loop instead of falling through to the
+// remaining configured providers.
+func TestIntrospectTriesRemainingProvidersAfterOneFails(t *testing.T) {
+	providers := []Provider{
+		{Issuer: "https://down.example.com", ValidationMode: ValidationModeIntrospection, ClientAuthMethod: ClientAuthNone, IntrospectionEndpoint: "https://down.example.com/introspect", ClientIDs: []string{"client"}},
+		{Issuer: "https://up.example.com", ValidationMode: ValidationModeIntrospection, ClientAuthMethod: ClientAuthNone, IntrospectionEndpoint: "https://up.example.com/introspect", ClientIDs: []string{"client"}},
+	}
+
+	tv := newIntrospectionTokenValidator(func() ([]Provider, error) { return providers, nil }, &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if strings.Contains(req.URL.Host, "down.example.com") {
+				return &http.Response{StatusCode: http.StatusInternalServerError, Body: io.NopCloser(strings.NewReader(""))}, nil
+			}
+			return jsonResponse(fmt.Sprintf(`{"active": true, "aud": "client", "exp": %d}`, time.Now().Add(time.Hour).Unix())), nil
+		}),
+	}, time.Minute)
+
+	jt, err := tv.introspect(newTestIntrospectionRequest(), "opaque-token")
+	if err != nil {
+		t.Fatalf("expected introspection to succeed via the second provider, got %v", err)
+	}
+	if jt == nil || !jt.Valid {
+		t.Fatalf("expected a valid token")
+	}
+}
+
+// TestIntrospectRejectsWrongAudience asserts a token the introspection
+// endpoint reports as active, but whose 'aud' doesn't match any of the
+// resolved provider's ClientIDs, is rejected rather than trusted outright.
+func TestIntrospectRejectsWrongAudience(t *testing.T) {
+	providers := []Provider{
+		{Issuer: "https://issuer.example.com", ValidationMode: ValidationModeIntrospection, ClientAuthMethod: ClientAuthNone, IntrospectionEndpoint: "https://issuer.example.com/introspect", ClientIDs: []string{"expected-client"}},
+	}
+
+	tv := newIntrospectionTokenValidator(func() ([]Provider, error) { return providers, nil }, &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return jsonResponse(fmt.Sprintf(`{"active": true, "aud": "other-client", "exp": %d}`, time.Now().Add(time.Hour).Unix())), nil
+		}),
+	}, time.Minute)
+
+	if _, err := tv.introspect(newTestIntrospectionRequest(), "opaque-token"); err == nil {
+		t.Fatalf("expected a token whose 'aud' doesn't match the provider's ClientIDs to be rejected")
+	}
+}
+
+// TestIntrospectRejectsMismatchedRequiredClaim asserts RequiredClaims is
+// enforced against the introspection response the same way it is for JWTs.
+func TestIntrospectRejectsMismatchedRequiredClaim(t *testing.T) {
+	providers := []Provider{
+		{
+			Issuer:                "https://issuer.example.com",
+			ValidationMode:        ValidationModeIntrospection,
+			ClientAuthMethod:      ClientAuthNone,
+			IntrospectionEndpoint: "https://issuer.example.com/introspect",
+			ClientIDs:             []string{"client"},
+			RequiredClaims:        map[string]interface{}{"scope": "admin"},
+		},
+	}
+
+	tv := newIntrospectionTokenValidator(func() ([]Provider, error) { return providers, nil }, &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return jsonResponse(fmt.Sprintf(`{"active": true, "aud": "client", "scope": "user", "exp": %d}`, time.Now().Add(time.Hour).Unix())), nil
+		}),
+	}, time.Minute)
+
+	if _, err := tv.introspect(newTestIntrospectionRequest(), "opaque-token"); err == nil {
+		t.Fatalf("expected a token whose claim doesn't match RequiredClaims to be rejected")
+	}
+}
+
+// TestIntrospectEnforcesProofOfPossession asserts a provider configured with
+// RequireProofOfPossession rejects an introspected token that carries no
+// 'cnf' claim, just as the JWT path does.
+func TestIntrospectEnforcesProofOfPossession(t *testing.T) {
+	providers := []Provider{
+		{
+			Issuer:                   "https://issuer.example.com",
+			ValidationMode:           ValidationModeIntrospection,
+			ClientAuthMethod:         ClientAuthNone,
+			IntrospectionEndpoint:    "https://issuer.example.com/introspect",
+			ClientIDs:                []string{"client"},
+			RequireProofOfPossession: true,
+		},
+	}
+
+	tv := newIntrospectionTokenValidator(func() ([]Provider, error) { return providers, nil }, &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return jsonResponse(fmt.Sprintf(`{"active": true, "aud": "client", "exp": %d}`, time.Now().Add(time.Hour).Unix())), nil
+		}),
+	}, time.Minute)
+
+	if _, err := tv.introspect(newTestIntrospectionRequest(), "opaque-token"); err == nil {
+		t.Fatalf("expected a RequireProofOfPossession provider to reject a token with no 'cnf' claim")
+	}
+}
@@ -0,0 +1,86 @@
+package openid
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+)
+
+// defaultJwksRefreshRate and defaultJwksRefreshBurst bound how often a
+// single issuer's JWKS can be refreshed in response to an unknown kid or a
+// bad signature, so that a flood of tokens carrying random kid values can't
+// be used to hammer the IdP's JWKS endpoint.
+const defaultJwksRefreshRate = rate.Limit(1.0 / 60.0)
+const defaultJwksRefreshBurst = 5
+
+// jwksRefreshLimiter rate-limits JWKS refreshes per issuer and coalesces
+// concurrent refreshes for the same issuer so that a burst of requests that
+// all miss the signing key cache results in a single upstream fetch.
+type jwksRefreshLimiter struct {
+	rate  rate.Limit
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+
+	group singleflight.Group
+}
+
+func newJwksRefreshLimiter(r rate.Limit, burst int) *jwksRefreshLimiter {
+	if r <= 0 {
+		r = defaultJwksRefreshRate
+	}
+	if burst <= 0 {
+		burst = defaultJwksRefreshBurst
+	}
+
+	return &jwksRefreshLimiter{
+		rate:     r,
+		burst:    burst,
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+func (l *jwksRefreshLimiter) limiterFor(iss string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lim, ok := l.limiters[iss]
+	if !ok {
+		lim = rate.NewLimiter(l.rate, l.burst)
+		l.limiters[iss] = lim
+	}
+
+	return lim
+}
+
+// allow reports whether a JWKS refresh for iss may proceed right now. It
+// does not block; a throttled refresh should fail fast rather than queue,
+// since the caller is serving an HTTP request.
+func (l *jwksRefreshLimiter) allow(iss string) bool {
+	return l.limiterFor(iss).Allow()
+}
+
+// refresh runs fn at most once per issuer for any set of concurrent
+// callers, via singleflight, so that spraying many tokens with the same
+// unknown kid for the same issuer triggers a single upstream JWKS fetch.
+func (l *jwksRefreshLimiter) refresh(iss string, fn func() error) error {
+	_, err, _ := l.group.Do(iss, func() (interface{}, error) {
+		return nil, fn()
+	})
+	return err
+}
+
+// throttledJwksRefreshError builds the ValidationError returned when a refresh is denied
+// because the rate limiter's bucket for iss is empty and the signing key
+// cache still doesn't have the requested kid.
+func throttledJwksRefreshError(iss string) *ValidationError {
+	return &ValidationError{
+		Code:       ValidationErrorJwksRefreshThrottled,
+		Message:    fmt.Sprintf("JWKS refreshes for issuer %v are being throttled; try again shortly.", iss),
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
@@ -0,0 +1,67 @@
+package openid
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestJwksRefreshLimiterCoalescesConcurrentRefreshes fires many concurrent
+// refreshes for the same issuer - the shape of an attacker spraying tokens
+// with random kids (or bad signatures) against one issuer - and asserts the
+// upstream refresh function only actually runs once.
+func TestJwksRefreshLimiterCoalescesConcurrentRefreshes(t *testing.T) {
+	limiter := newJwksRefreshLimiter(rate.Inf, 1)
+
+	var fetches, started int32
+	var wg sync.WaitGroup
+
+	const callers = 50
+	wg.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			defer wg.Done()
+			atomic.AddInt32(&started, 1)
+			_ = limiter.refresh("https://issuer.example.com", func() error {
+				atomic.AddInt32(&fetches, 1)
+				// Keep the refresh in flight until every caller has started,
+				// so that all of them join it rather than starting their own.
+				for atomic.LoadInt32(&started) < callers {
+					runtime.Gosched()
+				}
+				time.Sleep(50 * time.Millisecond)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Fatalf("expected exactly 1 upstream JWKS fetch for concurrent refreshes, got %d", got)
+	}
+}
+
+// TestJwksRefreshLimiterThrottlesPerIssuer asserts the token bucket denies
+// refreshes once its burst is exhausted, and that this is scoped per issuer
+// rather than global.
+func TestJwksRefreshLimiterThrottlesPerIssuer(t *testing.T) {
+	limiter := newJwksRefreshLimiter(rate.Limit(0), 2)
+
+	const issuerA = "https://a.example.com"
+	const issuerB = "https://b.example.com"
+
+	if !limiter.allow(issuerA) || !limiter.allow(issuerA) {
+		t.Fatalf("expected the first 2 refreshes (the configured burst) for issuer A to be allowed")
+	}
+	if limiter.allow(issuerA) {
+		t.Fatalf("expected a 3rd refresh for issuer A to be throttled once the burst is exhausted")
+	}
+
+	if !limiter.allow(issuerB) {
+		t.Fatalf("expected issuer B's bucket to be independent of issuer A's")
+	}
+}
@@ -0,0 +1,305 @@
+package openid
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const cnfClaimName = "cnf"
+const cnfX5tS256MemberName = "x5t#S256"
+const cnfJktMemberName = "jkt"
+const dpopHeaderName = "DPoP"
+const dpopTypeHeaderValue = "dpop+jwt"
+
+const dpopHTMClaimName = "htm"
+const dpopHTUClaimName = "htu"
+const dpopIatClaimName = "iat"
+const dpopAthClaimName = "ath"
+
+// dpopMaxAge bounds how old a DPoP proof's iat may be; it exists to limit
+// the replay window rather than to model any real token lifetime.
+const dpopMaxAge = 5 * time.Minute
+
+// validateProofOfPossession enforces RFC 8705 (mTLS-bound tokens) and
+// RFC 9449 (DPoP) sender-constraint checks for a Provider configured with
+// RequireProofOfPossession. It inspects the token's cnf claim and, for a
+// jkt confirmation, the request's DPoP header. It is a no-op for providers
+// that don't require proof of possession; for those that do, a token with no
+// cnf claim is rejected.
+func validateProofOfPossession(r *http.Request, t string, jt *jwt.Token, p *Provider) error {
+	if !p.RequireProofOfPossession {
+		return nil
+	}
+
+	claims := jt.Claims.(jwt.MapClaims)
+	cnf, ok := claims[cnfClaimName].(map[string]interface{})
+	if !ok {
+		return &ValidationError{
+			Code:       ValidationErrorProofOfPossessionMissing,
+			Message:    "The provider requires a proof-of-possession bound token but the token has no 'cnf' claim.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if x5tS256, ok := cnf[cnfX5tS256MemberName].(string); ok {
+		return validateMTLSBinding(r, x5tS256)
+	}
+
+	if jkt, ok := cnf[cnfJktMemberName].(string); ok {
+		return validateDPoPBinding(r, t, jkt)
+	}
+
+	return &ValidationError{
+		Code:       ValidationErrorProofOfPossessionMissing,
+		Message:    "The token's 'cnf' claim does not contain a supported confirmation method ('x5t#S256' or 'jkt').",
+		HTTPStatus: http.StatusUnauthorized,
+	}
+}
+
+// validateMTLSBinding implements RFC 8705 3.1: the SHA-256 thumbprint of the
+// client certificate presented on the mTLS connection must match cnf.x5t#S256.
+func validateMTLSBinding(r *http.Request, x5tS256 string) error {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return &ValidationError{
+			Code:       ValidationErrorProofOfPossessionInvalid,
+			Message:    "The token is bound to a client certificate but the request presented none.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	thumbprint := certificateThumbprint(r.TLS.PeerCertificates[0])
+	if thumbprint != x5tS256 {
+		return &ValidationError{
+			Code:       ValidationErrorProofOfPossessionInvalid,
+			Message:    "The client certificate presented on the connection does not match the token's 'cnf.x5t#S256'.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return nil
+}
+
+func certificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// validateDPoPBinding implements RFC 9449: the request must carry a DPoP
+// header whose JWS is signed by the key whose RFC 7638 thumbprint matches
+// cnf.jkt, and whose htm/htu/iat/ath claims match the current request and
+// access token.
+func validateDPoPBinding(r *http.Request, t string, jkt string) error {
+	proof := r.Header.Get(dpopHeaderName)
+	if proof == "" {
+		return &ValidationError{
+			Code:       ValidationErrorProofOfPossessionMissing,
+			Message:    "The token is DPoP-bound but the request carried no 'DPoP' header.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	var jwk map[string]interface{}
+	dt, err := jwt.Parse(proof, func(tok *jwt.Token) (interface{}, error) {
+		typ, _ := tok.Header["typ"].(string)
+		if typ != dpopTypeHeaderValue {
+			return nil, fmt.Errorf("unexpected DPoP proof 'typ': %v", typ)
+		}
+
+		var ok bool
+		jwk, ok = tok.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("DPoP proof is missing a 'jwk' header")
+		}
+
+		thumbprint, err := jwkThumbprint(jwk)
+		if err != nil {
+			return nil, err
+		}
+		if thumbprint != jkt {
+			return nil, fmt.Errorf("DPoP proof key thumbprint does not match the token's 'cnf.jkt'")
+		}
+
+		return publicKeyFromJWK(jwk)
+	}, jwt.WithValidMethods(allOrDefaultAlgorithms(nil)))
+	if err != nil || !dt.Valid {
+		return &ValidationError{
+			Code:       ValidationErrorProofOfPossessionInvalid,
+			Message:    fmt.Sprintf("The DPoP proof could not be verified: %v.", err),
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	claims := dt.Claims.(jwt.MapClaims)
+
+	if htm, _ := claims[dpopHTMClaimName].(string); !strings.EqualFold(htm, r.Method) {
+		return &ValidationError{
+			Code:       ValidationErrorProofOfPossessionInvalid,
+			Message:    "The DPoP proof's 'htm' claim does not match the request method.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if htu, _ := claims[dpopHTUClaimName].(string); !matchesRequestURI(htu, r) {
+		return &ValidationError{
+			Code:       ValidationErrorProofOfPossessionInvalid,
+			Message:    "The DPoP proof's 'htu' claim does not match the request URI.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	if iat, err := claims.GetIssuedAt(); err != nil || iat == nil || time.Since(iat.Time) > dpopMaxAge {
+		return &ValidationError{
+			Code:       ValidationErrorProofOfPossessionInvalid,
+			Message:    "The DPoP proof is missing a valid 'iat' or is too old to be trusted.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	ath, _ := claims[dpopAthClaimName].(string)
+	if ath == "" || ath != accessTokenHash(t) {
+		return &ValidationError{
+			Code:       ValidationErrorProofOfPossessionInvalid,
+			Message:    "The DPoP proof's 'ath' claim does not match the access token it was presented with.",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	return nil
+}
+
+// accessTokenHash computes the DPoP 'ath' claim value: base64url(SHA-256(access_token)).
+func accessTokenHash(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// requestScheme reports the scheme the client actually used, trusting
+// X-Forwarded-Proto ahead of r.TLS. TLS almost always terminates in front of
+// the Go process in production (load balancer, reverse proxy, sidecar),
+// where r.TLS is nil in-process even though the original request was https.
+func requestScheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		return strings.ToLower(strings.TrimSpace(strings.SplitN(proto, ",", 2)[0]))
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func matchesRequestURI(htu string, r *http.Request) bool {
+	return htu == requestScheme(r)+"://"+r.Host+r.URL.Path
+}
+
+// jwkThumbprint computes the RFC 7638 JWK thumbprint: the base64url-encoded
+// SHA-256 hash of the JSON of the required members, in lexicographic order,
+// with no extra whitespace.
+func jwkThumbprint(jwk map[string]interface{}) (string, error) {
+	var members map[string]string
+
+	switch jwk["kty"] {
+	case "RSA":
+		members = map[string]string{"e": "e", "kty": "kty", "n": "n"}
+	case "EC":
+		members = map[string]string{"crv": "crv", "kty": "kty", "x": "x", "y": "y"}
+	case "OKP":
+		members = map[string]string{"crv": "crv", "kty": "kty", "x": "x"}
+	default:
+		return "", fmt.Errorf("unsupported JWK 'kty': %v", jwk["kty"])
+	}
+
+	canonical := make(map[string]string, len(members))
+	for field := range members {
+		v, _ := jwk[field].(string)
+		canonical[field] = v
+	}
+
+	encoded, err := json.Marshal(canonical)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// publicKeyFromJWK parses the minimal set of JWK members used to verify a
+// DPoP proof (RSA, EC, or OKP/Ed25519) into the concrete public key
+// jwt.Parse needs.
+func publicKeyFromJWK(jwk map[string]interface{}) (interface{}, error) {
+	switch jwk["kty"] {
+	case "RSA":
+		n, err := base64URLBigInt(jwk, "n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64URLBigInt(jwk, "e")
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		curve, err := ecCurve(jwk["crv"])
+		if err != nil {
+			return nil, err
+		}
+		x, err := base64URLBigInt(jwk, "x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64URLBigInt(jwk, "y")
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if jwk["crv"] != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP 'crv': %v", jwk["crv"])
+		}
+		x, err := base64URLBigInt(jwk, "x")
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x.FillBytes(make([]byte, ed25519.PublicKeySize))), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported DPoP proof key 'kty': %v", jwk["kty"])
+	}
+}
+
+func base64URLBigInt(jwk map[string]interface{}, member string) (*big.Int, error) {
+	s, _ := jwk[member].(string)
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWK member %q: %w", member, err)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func ecCurve(crv interface{}) (elliptic.Curve, error) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported JWK 'crv': %v", crv)
+	}
+}
@@ -0,0 +1,266 @@
+package openid
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func rsaJWK(t *testing.T, key *rsa.PrivateKey) map[string]interface{} {
+	t.Helper()
+	return map[string]interface{}{
+		"kty": "RSA",
+		"n":   b64(key.N.Bytes()),
+		"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(t *testing.T, key *ecdsa.PrivateKey) map[string]interface{} {
+	t.Helper()
+	return map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   b64(key.X.Bytes()),
+		"y":   b64(key.Y.Bytes()),
+	}
+}
+
+func okpJWK(pub ed25519.PublicKey) map[string]interface{} {
+	return map[string]interface{}{
+		"kty": "OKP",
+		"crv": "Ed25519",
+		"x":   b64(pub),
+	}
+}
+
+func TestPublicKeyFromJWK(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey: %v", err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+
+	t.Run("RSA", func(t *testing.T) {
+		got, err := publicKeyFromJWK(rsaJWK(t, rsaKey))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		key, ok := got.(*rsa.PublicKey)
+		if !ok || key.N.Cmp(rsaKey.N) != 0 || key.E != rsaKey.E {
+			t.Fatalf("publicKeyFromJWK did not reconstruct the original RSA key")
+		}
+	})
+
+	t.Run("EC", func(t *testing.T) {
+		got, err := publicKeyFromJWK(ecJWK(t, ecKey))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		key, ok := got.(*ecdsa.PublicKey)
+		if !ok || key.X.Cmp(ecKey.X) != 0 || key.Y.Cmp(ecKey.Y) != 0 {
+			t.Fatalf("publicKeyFromJWK did not reconstruct the original EC key")
+		}
+	})
+
+	t.Run("OKP", func(t *testing.T) {
+		got, err := publicKeyFromJWK(okpJWK(edPub))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		key, ok := got.(ed25519.PublicKey)
+		if !ok || !key.Equal(edPub) {
+			t.Fatalf("publicKeyFromJWK did not reconstruct the original Ed25519 key")
+		}
+	})
+
+	t.Run("unsupported kty", func(t *testing.T) {
+		if _, err := publicKeyFromJWK(map[string]interface{}{"kty": "oct"}); err == nil {
+			t.Fatalf("expected an unsupported 'kty' to be rejected")
+		}
+	})
+
+	t.Run("unsupported crv for OKP", func(t *testing.T) {
+		if _, err := publicKeyFromJWK(map[string]interface{}{"kty": "OKP", "crv": "X25519", "x": b64(edPub)}); err == nil {
+			t.Fatalf("expected an unsupported OKP 'crv' to be rejected")
+		}
+	})
+}
+
+func TestJwkThumbprintIsStableAndCoversEveryKty(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	for _, jwk := range []map[string]interface{}{rsaJWK(t, rsaKey), ecJWK(t, ecKey), okpJWK(edPub)} {
+		tp1, err := jwkThumbprint(jwk)
+		if err != nil {
+			t.Fatalf("jwkThumbprint(%v): %v", jwk["kty"], err)
+		}
+		tp2, err := jwkThumbprint(jwk)
+		if err != nil {
+			t.Fatalf("jwkThumbprint(%v) second call: %v", jwk["kty"], err)
+		}
+		if tp1 != tp2 {
+			t.Fatalf("jwkThumbprint(%v) is not stable across calls: %v != %v", jwk["kty"], tp1, tp2)
+		}
+	}
+
+	if _, err := jwkThumbprint(map[string]interface{}{"kty": "oct"}); err == nil {
+		t.Fatalf("expected an unsupported 'kty' to be rejected")
+	}
+}
+
+func TestCertificateThumbprint(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1)}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate: %v", err)
+	}
+
+	want := sha256.Sum256(cert.Raw)
+	if got := certificateThumbprint(cert); got != base64.RawURLEncoding.EncodeToString(want[:]) {
+		t.Fatalf("certificateThumbprint() = %v, want the base64url SHA-256 of the raw certificate", got)
+	}
+}
+
+func TestRequestSchemePrefersXForwardedProtoOverTLS(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		tls    bool
+		want   string
+	}{
+		{name: "no header, no TLS defaults to http", want: "http"},
+		{name: "no header, TLS present uses https", tls: true, want: "https"},
+		{name: "X-Forwarded-Proto https overrides nil TLS", header: "https", want: "https"},
+		{name: "X-Forwarded-Proto is case-insensitive", header: "HTTPS", want: "https"},
+		{name: "X-Forwarded-Proto takes only the first of a comma-separated list", header: "https, http", want: "https"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/resource", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.header)
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+
+			if got := requestScheme(r); got != tt.want {
+				t.Fatalf("requestScheme() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesRequestURI(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/resource", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+
+	if !matchesRequestURI("https://example.com/resource", r) {
+		t.Fatalf("expected the 'htu' claim to match the forwarded-https reconstruction of the request")
+	}
+	if matchesRequestURI("http://example.com/resource", r) {
+		t.Fatalf("expected the 'htu' claim built from the unproxied scheme to no longer match")
+	}
+}
+
+func TestValidateDPoPBindingAcceptsAValidEd25519Proof(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+
+	jwk := okpJWK(pub)
+	thumbprint, err := jwkThumbprint(jwk)
+	if err != nil {
+		t.Fatalf("jwkThumbprint: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/resource", nil)
+	accessToken := "the-access-token"
+
+	proof := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		dpopHTMClaimName: r.Method,
+		dpopHTUClaimName: "http://example.com/resource",
+		dpopIatClaimName: time.Now().Unix(),
+		dpopAthClaimName: accessTokenHash(accessToken),
+	})
+	proof.Header["typ"] = dpopTypeHeaderValue
+	proof.Header["jwk"] = jwk
+
+	signed, err := proof.SignedString(priv)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	r.Header.Set(dpopHeaderName, signed)
+
+	if err := validateDPoPBinding(r, accessToken, thumbprint); err != nil {
+		t.Fatalf("expected a valid DPoP proof to be accepted, got %v", err)
+	}
+}
+
+func TestValidateDPoPBindingRejectsAthMismatch(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+
+	jwk := okpJWK(pub)
+	thumbprint, err := jwkThumbprint(jwk)
+	if err != nil {
+		t.Fatalf("jwkThumbprint: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/resource", nil)
+
+	proof := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{
+		dpopHTMClaimName: r.Method,
+		dpopHTUClaimName: "http://example.com/resource",
+		dpopIatClaimName: time.Now().Unix(),
+		dpopAthClaimName: accessTokenHash("a-different-access-token"),
+	})
+	proof.Header["typ"] = dpopTypeHeaderValue
+	proof.Header["jwk"] = jwk
+
+	signed, err := proof.SignedString(priv)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	r.Header.Set(dpopHeaderName, signed)
+
+	if err := validateDPoPBinding(r, "the-access-token", thumbprint); err == nil {
+		t.Fatalf("expected a proof bound to a different access token to be rejected")
+	}
+}
@@ -0,0 +1,70 @@
+package openid
+
+import (
+	"errors"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+// countingSigningKeyGetter simulates an IdP's JWKS endpoint: every
+// flushCachedSigningKeys call is one upstream fetch, and getSigningKey never
+// has the kid a caller is asking for, which is what forces a refresh. A fetch
+// stays in flight until started reaches callers, so that every concurrent
+// caller has the chance to join it.
+type countingSigningKeyGetter struct {
+	fetches int32
+	started int32
+	callers int32
+}
+
+func (g *countingSigningKeyGetter) getSigningKey(r *http.Request, issuer string, kid string) ([]byte, error) {
+	return nil, errors.New("kid not found")
+}
+
+func (g *countingSigningKeyGetter) flushCachedSigningKeys(issuer string) error {
+	atomic.AddInt32(&g.fetches, 1)
+	for atomic.LoadInt32(&g.started) < g.callers {
+		runtime.Gosched()
+	}
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+// TestRenewAndGetSigningKeyThrottlesConcurrentInvalidSignatureRequests fires
+// many concurrent calls simulating the retry path that runs whenever a
+// token's signature fails to verify - the attack is spraying tokens with
+// random kids, or flipping a signature byte on an otherwise-valid token, to
+// force a JWKS refetch per request - and asserts the rate limiter collapses
+// them into a single upstream fetch.
+func TestRenewAndGetSigningKeyThrottlesConcurrentInvalidSignatureRequests(t *testing.T) {
+	const callers = 50
+	keyGetter := &countingSigningKeyGetter{callers: callers}
+	tv := newIDTokenValidator(nil, nil, keyGetter, nil)
+	tv.refreshLimiter = newJwksRefreshLimiter(rate.Inf, 1)
+
+	jt := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		issuerClaimName: "https://issuer.example.com",
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			defer wg.Done()
+			atomic.AddInt32(&keyGetter.started, 1)
+			_, _ = tv.renewAndGetSigningKey(nil, jt)
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&keyGetter.fetches); got != 1 {
+		t.Fatalf("expected exactly 1 upstream JWKS fetch for %d concurrent invalid-signature requests, got %d", callers, got)
+	}
+}
@@ -0,0 +1,43 @@
+package openid
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TestValidateAlgorithmAllowsOnlyTheProvidersConfiguredAlgorithms guards
+// against the eager-evaluation bug where jwt.WithValidMethods(...) was built
+// as a plain ParserOption argument before the matching provider (and its
+// AllowedAlgorithms) was known, so every token was checked against the
+// package default list regardless of what the provider configured.
+func TestValidateAlgorithmAllowsOnlyTheProvidersConfiguredAlgorithms(t *testing.T) {
+	p := &Provider{AllowedAlgorithms: []string{jwt.SigningMethodES256.Alg()}}
+
+	allowed := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{})
+	if err := validateAlgorithm(allowed, p); err != nil {
+		t.Fatalf("expected the provider's configured algorithm to be allowed, got %v", err)
+	}
+
+	disallowed := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{})
+	if err := validateAlgorithm(disallowed, p); err == nil {
+		t.Fatalf("expected an algorithm outside the provider's AllowedAlgorithms to be rejected")
+	}
+}
+
+// TestValidateAlgorithmFallsBackToPackageDefaults asserts a provider that
+// hasn't configured AllowedAlgorithms still accepts the RSA/ECDSA/EdDSA
+// algorithms this package knows how to verify, and still rejects 'none'.
+func TestValidateAlgorithmFallsBackToPackageDefaults(t *testing.T) {
+	p := &Provider{}
+
+	rs256 := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{})
+	if err := validateAlgorithm(rs256, p); err != nil {
+		t.Fatalf("expected RS256 to be allowed by the package default list, got %v", err)
+	}
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{})
+	if err := validateAlgorithm(none, p); err == nil {
+		t.Fatalf("expected 'none' to be rejected even with no configured AllowedAlgorithms")
+	}
+}
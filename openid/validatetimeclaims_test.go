@@ -0,0 +1,98 @@
+package openid
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func fixedClock(at time.Time) func() time.Time {
+	return func() time.Time { return at }
+}
+
+// TestValidateTimeClaimsExpNbfIat exercises validateTimeClaims' exp/nbf/iat
+// branches with an injected Clock, so the checks don't depend on wall-clock
+// time and the allowedClockSkew leeway can be asserted precisely.
+func TestValidateTimeClaimsExpNbfIat(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	skew := 30 * time.Second
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		wantErr bool
+	}{
+		{
+			name:    "valid token within exp/nbf/iat",
+			claims:  jwt.MapClaims{"exp": float64(now.Add(time.Hour).Unix()), "nbf": float64(now.Add(-time.Hour).Unix()), "iat": float64(now.Add(-time.Minute).Unix())},
+			wantErr: false,
+		},
+		{
+			name:    "expired token is rejected",
+			claims:  jwt.MapClaims{"exp": float64(now.Add(-time.Minute).Unix())},
+			wantErr: true,
+		},
+		{
+			name:    "exp within allowed clock skew is accepted",
+			claims:  jwt.MapClaims{"exp": float64(now.Add(-skew / 2).Unix())},
+			wantErr: false,
+		},
+		{
+			name:    "not-yet-valid token is rejected",
+			claims:  jwt.MapClaims{"nbf": float64(now.Add(time.Minute).Unix())},
+			wantErr: true,
+		},
+		{
+			name:    "nbf within allowed clock skew is accepted",
+			claims:  jwt.MapClaims{"nbf": float64(now.Add(skew / 2).Unix())},
+			wantErr: false,
+		},
+		{
+			name:    "iat in the future is rejected",
+			claims:  jwt.MapClaims{"iat": float64(now.Add(time.Minute).Unix())},
+			wantErr: true,
+		},
+		{
+			name:    "no time claims at all is accepted",
+			claims:  jwt.MapClaims{},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tv := &idTokenValidator{allowedClockSkew: skew, clock: fixedClock(now)}
+			jt := jwt.NewWithClaims(jwt.SigningMethodRS256, tt.claims)
+
+			err := tv.validateTimeClaims(jt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateTimeClaims() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateTimeClaimsMaxTokenAge asserts a token whose iat is older than
+// maxTokenAge is rejected even though its exp is still far in the future,
+// and that the check is a no-op when maxTokenAge isn't configured.
+func TestValidateTimeClaimsMaxTokenAge(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	maxAge := time.Hour
+
+	claims := jwt.MapClaims{
+		"iat": float64(now.Add(-2 * time.Hour).Unix()),
+		"exp": float64(now.Add(24 * time.Hour).Unix()),
+	}
+	jt := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+
+	withMaxAge := &idTokenValidator{clock: fixedClock(now), maxTokenAge: maxAge}
+	if err := withMaxAge.validateTimeClaims(jt); err == nil {
+		t.Fatalf("expected a token issued beyond MaxTokenAge to be rejected despite a future exp")
+	}
+
+	withoutMaxAge := &idTokenValidator{clock: fixedClock(now)}
+	if err := withoutMaxAge.validateTimeClaims(jt); err != nil {
+		t.Fatalf("expected MaxTokenAge to be a no-op when unset, got %v", err)
+	}
+}